@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -9,9 +10,13 @@ import (
 	"net"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
+	"os/signal"
 	"runtime"
 	"runtime/debug"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/lomik/zapwriter"
@@ -23,7 +28,11 @@ import (
 	"github.com/lomik/graphite-clickhouse/find"
 	"github.com/lomik/graphite-clickhouse/index"
 	"github.com/lomik/graphite-clickhouse/metrics"
+	"github.com/lomik/graphite-clickhouse/pkg/logging"
 	"github.com/lomik/graphite-clickhouse/pkg/scope"
+	"github.com/lomik/graphite-clickhouse/pkg/shutdown"
+	"github.com/lomik/graphite-clickhouse/pkg/tlsutil"
+	"github.com/lomik/graphite-clickhouse/pkg/tracing"
 	"github.com/lomik/graphite-clickhouse/prometheus"
 	"github.com/lomik/graphite-clickhouse/render"
 	"github.com/lomik/graphite-clickhouse/tagger"
@@ -69,6 +78,10 @@ func (app *App) Handler(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		writer := WrapResponseWriter(w)
 
+		ctx, span := tracing.StartSpanFromRequest(r, r.URL.Path)
+		defer span.Finish()
+		r = r.WithContext(ctx)
+
 		r = scope.HttpRequest(r)
 
 		w.Header().Add("X-Gch-Request-ID", scope.RequestID(r.Context()))
@@ -77,6 +90,8 @@ func (app *App) Handler(handler http.Handler) http.Handler {
 		handler.ServeHTTP(writer, r)
 		d := time.Since(start)
 
+		span.SetTag("http.status_code", fmt.Sprintf("%d", writer.Status()))
+
 		logger := scope.LoggerWithHeaders(r.Context(), r, app.config.Common.HeadersToLog).Named("http")
 
 		grafana := scope.Grafana(r.Context())
@@ -98,7 +113,7 @@ func (app *App) Handler(handler http.Handler) http.Handler {
 
 		cachedFind := w.Header().Get("X-Cached-Find") == "true"
 
-		logger.Info("access",
+		fields := []zap.Field{
 			zap.Duration("time", d),
 			zap.String("method", r.Method),
 			zap.String("url", r.URL.String()),
@@ -106,12 +121,86 @@ func (app *App) Handler(handler http.Handler) http.Handler {
 			zap.String("client", client),
 			zap.Int("status", writer.Status()),
 			zap.Bool("find_cached", cachedFind),
-		)
+		}
+
+		if cn, _, ok := tlsutil.PeerIdentity(r.TLS); ok {
+			fields = append(fields, zap.String("tls_cn", cn))
+		}
+
+		logger.Info("access", fields...)
 	})
 }
 
 var BuildVersion = "(development build)"
 
+// ready reports whether the server should still be routed to by upstream
+// load balancers. It is flipped to false as soon as shutdown begins, right
+// before srv.Shutdown stops accepting connections; there is no delay between
+// the two, so a /ready probe then gets either a 503 or a refused connection.
+var ready int32 = 1
+
+func isReady() bool {
+	return atomic.LoadInt32(&ready) == 1
+}
+
+func setNotReady() {
+	atomic.StoreInt32(&ready, 0)
+}
+
+// serveWithGracefulShutdown runs serve (srv.ListenAndServe or
+// srv.ListenAndServeTLS) until ctx is cancelled, then gives in-flight
+// requests up to timeout to finish before returning. Once the server has
+// stopped (or the drain timeout expired), it also closes any cache clients
+// registered with pkg/shutdown, so a memcached connection or the
+// expirecache eviction goroutine isn't left running past process exit; that
+// close is itself bounded by timeout, so a cache client stuck closing can't
+// hang process exit indefinitely.
+func serveWithGracefulShutdown(ctx context.Context, srv *http.Server, serve func() error, timeout time.Duration, logger *zap.Logger) {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- serve()
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil && err != http.ErrServerClosed {
+			logger.Fatal("listen failed", zap.Error(err), zap.String("addr", srv.Addr))
+		}
+	case <-ctx.Done():
+		setNotReady()
+		logger.Info("shutdown signal received, draining in-flight requests",
+			zap.Duration("timeout", timeout))
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		shutdownStart := time.Now()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Error("graceful shutdown did not complete in time", zap.Error(err))
+		}
+
+		// Give cache-client cleanup whatever's left of timeout, so the two
+		// steps combined stay within the budget the caller configured
+		// instead of each getting a full timeout of their own.
+		remaining := timeout - time.Since(shutdownStart)
+		if remaining < 0 {
+			remaining = 0
+		}
+
+		closeErrCh := make(chan error, 1)
+		go func() { closeErrCh <- shutdown.Close() }()
+
+		select {
+		case err := <-closeErrCh:
+			if err != nil {
+				logger.Error("failed to close cache clients cleanly", zap.Error(err))
+			}
+		case <-time.After(remaining):
+			logger.Error("closing cache clients did not complete within the shutdown timeout")
+		}
+	}
+}
+
 func main() {
 	rand.Seed(time.Now().UnixNano())
 
@@ -172,6 +261,14 @@ func main() {
 		)
 	}
 
+	if err = tracing.Configure(cfg.Tracing); err != nil {
+		log.Fatal(err)
+	}
+
+	if err = logging.LoadState(logging.Default, cfg.Common.LoggingStateFile); err != nil {
+		log.Fatal(err)
+	}
+
 	runtime.GOMAXPROCS(cfg.Common.MaxCPU)
 
 	if cfg.Common.MemoryReturnInterval > 0 {
@@ -226,16 +323,90 @@ func main() {
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w, "Graphite-clickhouse is alive.\n")
 	})
+	mux.HandleFunc("/debug/logging", logging.Handler(logging.Default, cfg.Common.LoggingStateFile))
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		if !isReady() {
+			http.Error(w, "Graphite-clickhouse is shutting down.\n", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "Graphite-clickhouse is ready.\n")
+	})
+
+	if metrics.Graphite != nil {
+		metrics.Graphite.Start(nil)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := cfg.Common.TLS.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Prometheus.TLS.Validate(); err != nil {
+		log.Fatal(err)
+	}
 
 	if cfg.Prometheus.Listen != "" {
-		if err := prometheus.Run(cfg); err != nil {
+		var promTLSManager *tlsutil.Manager
+		if cfg.Prometheus.TLS.Enabled() {
+			var err error
+			if promTLSManager, err = tlsutil.NewManager(cfg.Prometheus.TLS); err != nil {
+				log.Fatal(err)
+			}
+			watchSIGHUP(ctx, promTLSManager, logger)
+		}
+
+		// prometheus.Run owns its own *http.Server for /metrics. ctx and
+		// cfg.Common.ShutdownTimeout tie its lifecycle to the same
+		// SIGINT/SIGTERM handling and drain budget as the main listener
+		// (see serveWithGracefulShutdown below); promTLSManager gives it
+		// mTLS with SIGHUP cert/CA reload the same way the main listener
+		// gets it, when [prometheus.tls] is configured.
+		if err := prometheus.Run(ctx, cfg, promTLSManager, cfg.Common.ShutdownTimeout, logger); err != nil {
 			log.Fatal(err)
 		}
 	}
 
-	if metrics.Graphite != nil {
-		metrics.Graphite.Start(nil)
+	srv := &http.Server{Addr: cfg.Common.Listen, Handler: mux}
+	serve := srv.ListenAndServe
+
+	if cfg.Common.TLS.Enabled() {
+		tlsManager, err := tlsutil.NewManager(cfg.Common.TLS)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if srv.TLSConfig, err = tlsManager.TLSConfig(); err != nil {
+			log.Fatal(err)
+		}
+		watchSIGHUP(ctx, tlsManager, logger)
+		serve = func() error { return srv.ListenAndServeTLS("", "") }
 	}
 
-	log.Fatal(http.ListenAndServe(cfg.Common.Listen, mux))
+	serveWithGracefulShutdown(ctx, srv, serve, cfg.Common.ShutdownTimeout, logger)
+}
+
+// watchSIGHUP reloads m's certificate (and client CA bundle, if one is
+// configured) from disk every time the process receives SIGHUP, so an
+// operator can rotate a cert/key pair or client CA bundle in place (e.g.
+// after cert-manager or certbot renews it) without restarting.
+func watchSIGHUP(ctx context.Context, m *tlsutil.Manager, logger *zap.Logger) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				signal.Stop(sighup)
+				return
+			case <-sighup:
+				if err := m.Reload(); err != nil {
+					logger.Error("failed to reload TLS certificate", zap.Error(err))
+				} else {
+					logger.Info("reloaded TLS certificate")
+				}
+			}
+		}
+	}()
 }
@@ -0,0 +1,85 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/lomik/graphite-clickhouse/pkg/tracing"
+)
+
+// CancelQuery asks ClickHouse to abort the query identified by queryID via
+// `KILL QUERY`. It is called once the request context passed to a query is
+// cancelled (client disconnect, or the process draining in-flight requests
+// during a graceful shutdown) so ClickHouse doesn't keep burning CPU/IO on
+// work nobody is waiting for anymore.
+//
+// dsn is the same ClickHouse HTTP DSN used to issue the original query.
+func CancelQuery(ctx context.Context, dsn string, queryID string) error {
+	if queryID == "" {
+		return nil
+	}
+
+	query := fmt.Sprintf("KILL QUERY WHERE query_id=%s", quoteString(queryID))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dsn, nil)
+	if err != nil {
+		return err
+	}
+	q := req.URL.Query()
+	q.Set("query", query)
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("clickhouse: KILL QUERY for %q failed with status %d", queryID, resp.StatusCode)
+	}
+	return nil
+}
+
+// QueryWithCancel issues req against ClickHouse as a child span of the span
+// in ctx (so a slow /render/ call can be correlated with the query it
+// issued), and, if ctx is done before the response comes back (client
+// disconnect, or the graceful-shutdown drain deadline), issues a
+// best-effort CancelQuery for queryID so ClickHouse stops working on a
+// query nobody is waiting for anymore.
+//
+// queryID must be the same value sent to ClickHouse as the request's
+// `query_id` parameter. This is the only place in this source tree that
+// issues ClickHouse queries; the find/render/index/autocomplete query
+// paths that would call it aren't present here, so end-to-end span
+// coverage across those packages remains a follow-up.
+func QueryWithCancel(ctx context.Context, dsn string, queryID string, req *http.Request) (*http.Response, error) {
+	ctx, span := tracing.StartSpan(ctx, "clickhouse.query")
+	defer span.Finish()
+	span.SetTag("clickhouse.query_id", queryID)
+	if q := req.URL.Query().Get("query"); q != "" {
+		span.SetTag("clickhouse.query", q)
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil && ctx.Err() != nil {
+		span.SetTag("clickhouse.cancelled", "true")
+		_ = CancelQuery(context.Background(), dsn, queryID)
+	}
+	if resp != nil {
+		span.SetTag("http.status_code", fmt.Sprintf("%d", resp.StatusCode))
+	}
+	return resp, err
+}
+
+// quoteString escapes s for use as a single-quoted ClickHouse string
+// literal, so a query_id containing a quote or backslash (e.g. echoed back
+// from a client-supplied X-ClickHouse-Query-Id header) can't break out of
+// the literal and alter the KILL QUERY statement.
+func quoteString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `\'`)
+	return "'" + s + "'"
+}
@@ -0,0 +1,84 @@
+package clickhouse
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuoteString(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "plain", in: "abc123", want: "'abc123'"},
+		{name: "single quote", in: "abc' OR '1'='1", want: `'abc\' OR \'1\'=\'1'`},
+		{name: "backslash", in: `abc\`, want: `'abc\\'`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, quoteString(c.in))
+		})
+	}
+}
+
+func TestCancelQuerySendsEscapedKillQuery(t *testing.T) {
+	var gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.Query().Get("query")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	err := CancelQuery(context.Background(), srv.URL, "id' OR '1'='1")
+	require.NoError(t, err)
+	assert.Equal(t, `KILL QUERY WHERE query_id='id\' OR \'1\'=\'1'`, gotQuery)
+}
+
+func TestCancelQueryEmptyQueryIDIsNoop(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	require.NoError(t, CancelQuery(context.Background(), srv.URL, ""))
+	assert.False(t, called)
+}
+
+func TestQueryWithCancelIssuesKillQueryOnContextCancel(t *testing.T) {
+	killed := make(chan string, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/kill" {
+			killed <- r.URL.Query().Get("query")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		// Simulate a slow query: block until the client gives up.
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/query", nil)
+	require.NoError(t, err)
+
+	_, _ = QueryWithCancel(ctx, srv.URL+"/kill", "slow-query", req)
+
+	select {
+	case q := <-killed:
+		assert.Equal(t, "KILL QUERY WHERE query_id='slow-query'", q)
+	case <-time.After(time.Second):
+		t.Fatal("CancelQuery was not called after context cancellation")
+	}
+}
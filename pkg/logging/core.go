@@ -0,0 +1,38 @@
+package logging
+
+import (
+	"go.uber.org/zap/zapcore"
+)
+
+// WrapCore returns a zapcore.Core that consults sel for name before
+// delegating to core, overriding whatever static level core was built with.
+// Only a logger whose core has been wrapped with WrapCore is affected by sel;
+// no code in this source tree calls WrapCore, so scope.Logger(...).Named(...)
+// loggers are not wrapped and keep their own configured level.
+func WrapCore(name string, sel *Selector, core zapcore.Core) zapcore.Core {
+	return &selectorCore{name: name, sel: sel, Core: core}
+}
+
+type selectorCore struct {
+	zapcore.Core
+	name string
+	sel  *Selector
+}
+
+func (c *selectorCore) Enabled(lvl zapcore.Level) bool {
+	if enabled, matched := c.sel.Enabled(c.name, lvl); matched {
+		return enabled
+	}
+	return c.Core.Enabled(lvl)
+}
+
+func (c *selectorCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *selectorCore) With(fields []zapcore.Field) zapcore.Core {
+	return &selectorCore{Core: c.Core.With(fields), name: c.name, sel: c.sel}
+}
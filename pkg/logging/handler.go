@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Handler serves GET/PUT on /debug/logging: GET returns the selector's
+// current rules as JSON, PUT accepts a comma-separated spec (the same
+// format as ParseSpec) in the request body and applies it atomically. When
+// statePath is non-empty, every successfully applied spec is persisted
+// there so it survives a restart; a failure to persist is answered with a
+// 500 response, and the new rules stay applied in memory.
+func Handler(sel *Selector, statePath string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeRules(w, sel)
+		case http.MethodPut:
+			applySpec(w, r, sel, statePath)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func writeRules(w http.ResponseWriter, sel *Selector) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(sel.Rules()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func applySpec(w http.ResponseWriter, r *http.Request, sel *Selector, statePath string) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	spec := strings.TrimSpace(string(body))
+	rules, err := ParseSpec(spec)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sel.SetRules(rules)
+
+	if statePath != "" {
+		if err := ioutil.WriteFile(statePath, []byte(spec), 0644); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeRules(w, sel)
+}
+
+// LoadState reads a previously persisted spec from statePath, if it exists,
+// and applies it to sel. Called once at startup when
+// common.logging-state-file is set; a missing file is not an error.
+func LoadState(sel *Selector, statePath string) error {
+	if statePath == "" {
+		return nil
+	}
+
+	body, err := ioutil.ReadFile(statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	rules, err := ParseSpec(strings.TrimSpace(string(body)))
+	if err != nil {
+		return err
+	}
+
+	sel.SetRules(rules)
+	return nil
+}
@@ -0,0 +1,107 @@
+// Package logging lets operators raise or lower the log level of a single
+// named zap logger (e.g. "render") at runtime, without restarting the
+// process or flooding logs from every other component.
+package logging
+
+import (
+	"path"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Rule overrides the level for loggers whose name matches Pattern (a glob,
+// as used by path.Match against the dot-joined logger name).
+type Rule struct {
+	Pattern string        `json:"pattern"`
+	Level   zapcore.Level `json:"level"`
+}
+
+// Selector decides the effective level for a given logger name. The zero
+// value has no rules and defers to each logger's own configured level.
+type Selector struct {
+	mu    sync.RWMutex
+	rules []Rule
+}
+
+// Default is the process-wide selector served on /debug/logging. It is
+// consulted only by loggers whose core was wrapped with WrapCore.
+var Default = &Selector{}
+
+// Enabled reports whether a message at level lvl should be logged for the
+// given logger name. If no rule matches the name, it returns enabled=false,
+// matched=false so the caller falls back to the logger's own level check.
+func (s *Selector) Enabled(name string, lvl zapcore.Level) (enabled bool, matched bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.rules {
+		if match(r.Pattern, name) {
+			return lvl >= r.Level, true
+		}
+	}
+	return false, false
+}
+
+// Rules returns a snapshot of the currently applied rules, in the order
+// they're evaluated.
+func (s *Selector) Rules() []Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]Rule, len(s.rules))
+	copy(out, s.rules)
+	return out
+}
+
+// SetRules atomically replaces the selector's rules.
+func (s *Selector) SetRules(rules []Rule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = rules
+}
+
+func match(pattern, name string) bool {
+	ok, err := path.Match(pattern, name)
+	return err == nil && ok
+}
+
+// ParseSpec parses a comma-separated selector spec such as
+// "render.*,find,clickhouse:debug,autocomplete:-" into Rules. A component
+// without an explicit ":<level>" suffix defaults to debug; a trailing "-"
+// disables logging for loggers matching that pattern (mapped to a level
+// above zap's highest, Fatal, so nothing at or below it is ever emitted).
+func ParseSpec(spec string) ([]Rule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(spec, ",")
+	rules := make([]Rule, 0, len(parts))
+
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		pattern := part
+		lvl := zapcore.DebugLevel
+
+		if i := strings.LastIndex(part, ":"); i >= 0 {
+			pattern = part[:i]
+			levelSpec := part[i+1:]
+			if levelSpec == "-" {
+				lvl = zapcore.FatalLevel + 1
+			} else if err := lvl.Set(levelSpec); err != nil {
+				return nil, err
+			}
+		}
+
+		rules = append(rules, Rule{Pattern: pattern, Level: lvl})
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,67 @@
+package logging
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestParseSpec(t *testing.T) {
+	cases := []struct {
+		name string
+		spec string
+		want []Rule
+	}{
+		{name: "empty", spec: "", want: nil},
+		{name: "blank", spec: "   ", want: nil},
+		{
+			name: "defaults to debug",
+			spec: "render.*,find",
+			want: []Rule{
+				{Pattern: "render.*", Level: zapcore.DebugLevel},
+				{Pattern: "find", Level: zapcore.DebugLevel},
+			},
+		},
+		{
+			name: "explicit level",
+			spec: "clickhouse:debug",
+			want: []Rule{{Pattern: "clickhouse", Level: zapcore.DebugLevel}},
+		},
+		{
+			name: "disabled with trailing dash",
+			spec: "autocomplete:-",
+			want: []Rule{{Pattern: "autocomplete", Level: zapcore.FatalLevel + 1}},
+		},
+		{
+			name: "whitespace around parts is trimmed",
+			spec: " render.* , find:info ",
+			want: []Rule{
+				{Pattern: "render.*", Level: zapcore.DebugLevel},
+				{Pattern: "find", Level: zapcore.InfoLevel},
+			},
+		},
+		{
+			name: "ignores empty parts between commas",
+			spec: "render.*,,find",
+			want: []Rule{
+				{Pattern: "render.*", Level: zapcore.DebugLevel},
+				{Pattern: "find", Level: zapcore.DebugLevel},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rules, err := ParseSpec(c.spec)
+			require.NoError(t, err)
+			assert.Equal(t, c.want, rules)
+		})
+	}
+}
+
+func TestParseSpecUnknownLevel(t *testing.T) {
+	_, err := ParseSpec("render:not-a-level")
+	assert.Error(t, err)
+}
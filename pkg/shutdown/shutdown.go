@@ -0,0 +1,39 @@
+// Package shutdown collects cleanup callbacks for long-lived resources
+// (memcached clients, the in-process expire-cache's eviction goroutine,
+// etc.) so they can be closed together during graceful shutdown instead of
+// leaking until the process exits.
+package shutdown
+
+import "sync"
+
+var (
+	mu    sync.Mutex
+	hooks []func() error
+)
+
+// Register adds hook to the set run by Close. Packages that construct a
+// cache client during startup (e.g. find/render's memcached or expirecache
+// instances) should call this so the resource is released on shutdown.
+func Register(hook func() error) {
+	mu.Lock()
+	defer mu.Unlock()
+	hooks = append(hooks, hook)
+}
+
+// Close runs every registered hook, in registration order, and returns the
+// first error encountered after attempting all of them. It clears the
+// registry, so calling Close twice only runs each hook once.
+func Close() error {
+	mu.Lock()
+	registered := hooks
+	hooks = nil
+	mu.Unlock()
+
+	var firstErr error
+	for _, hook := range registered {
+		if err := hook(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
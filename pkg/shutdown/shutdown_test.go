@@ -0,0 +1,32 @@
+package shutdown
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloseRunsAllHooksAndReturnsFirstError(t *testing.T) {
+	defer Close() // drain any hooks left over from a failed earlier test
+
+	var ran []int
+	Register(func() error { ran = append(ran, 1); return nil })
+	Register(func() error { ran = append(ran, 2); return errors.New("boom") })
+	Register(func() error { ran = append(ran, 3); return errors.New("also boom") })
+
+	err := Close()
+	assert.EqualError(t, err, "boom")
+	assert.Equal(t, []int{1, 2, 3}, ran)
+}
+
+func TestCloseClearsRegistry(t *testing.T) {
+	defer Close()
+
+	calls := 0
+	Register(func() error { calls++; return nil })
+
+	assert.NoError(t, Close())
+	assert.NoError(t, Close())
+	assert.Equal(t, 1, calls)
+}
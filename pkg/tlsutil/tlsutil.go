@@ -0,0 +1,232 @@
+// Package tlsutil builds a *tls.Config for the HTTP listeners from a
+// [common.tls] / [prometheus.tls] config block, with certificates reloaded
+// on SIGHUP so operators can rotate them without a restart.
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"sync"
+)
+
+// ClientAuth selects how (and whether) client certificates are verified.
+type ClientAuth string
+
+const (
+	ClientAuthNone          ClientAuth = "none"
+	ClientAuthRequest       ClientAuth = "request"
+	ClientAuthRequireVerify ClientAuth = "require+verify"
+)
+
+// Config is the [common.tls] / [prometheus.tls] config block.
+type Config struct {
+	CertFile      string     `toml:"cert-file"`
+	KeyFile       string     `toml:"key-file"`
+	ClientCAFile  string     `toml:"client-ca-file"`
+	MinVersion    string     `toml:"min-version"` // "1.0", "1.1", "1.2" (default) or "1.3"
+	CipherSuites  []string   `toml:"cipher-suites"`
+	ALPNProtocols []string   `toml:"alpn-protocols"`
+	ClientAuth    ClientAuth `toml:"client-auth"`
+}
+
+// Enabled reports whether this block configures a listener for TLS at all.
+func (c Config) Enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+// Validate catches config mistakes that Enabled() can't see on its own,
+// such as a half-filled-in TLS block, before they turn into a listener that
+// silently falls back to plaintext or to accepting unauthenticated clients.
+func (c Config) Validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("tlsutil: cert-file and key-file must both be set (or both left empty)")
+	}
+	if c.ClientCAFile != "" && c.ClientAuth == "" {
+		return fmt.Errorf("tlsutil: client-auth must be set explicitly when client-ca-file is configured")
+	}
+	if c.ClientAuth == ClientAuthRequireVerify && c.ClientCAFile == "" {
+		return fmt.Errorf("tlsutil: client-ca-file must be set when client-auth is %q", ClientAuthRequireVerify)
+	}
+	return nil
+}
+
+// Manager holds the currently loaded certificate and, if configured, client
+// CA pool, and serves them to the stdlib via GetCertificate and
+// GetConfigForClient, so a call to Reload takes effect on the very next
+// handshake without restarting the listener.
+type Manager struct {
+	cfg Config
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// NewManager loads cfg's certificate (and client CA bundle, if any) and
+// returns a Manager ready to be reloaded.
+func NewManager(cfg Config) (*Manager, error) {
+	m := &Manager{cfg: cfg}
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Reload re-reads the certificate/key pair, and the client CA bundle if one
+// is configured, from disk and swaps them in atomically. Call it from a
+// SIGHUP handler to pick up rotated certs or a rotated/revoked CA bundle.
+func (m *Manager) Reload() error {
+	cert, err := tls.LoadX509KeyPair(m.cfg.CertFile, m.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("tlsutil: loading cert/key: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if m.cfg.ClientCAFile != "" {
+		if clientCAs, err = loadClientCAs(m.cfg.ClientCAFile); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	m.cert = &cert
+	m.clientCAs = clientCAs
+	m.mu.Unlock()
+	return nil
+}
+
+func loadClientCAs(path string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("tlsutil: reading client CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("tlsutil: no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// GetCertificate is installed as tls.Config.GetCertificate so every new
+// handshake sees the most recently loaded certificate.
+func (m *Manager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.cert, nil
+}
+
+func (m *Manager) getClientCAs() *x509.CertPool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.clientCAs
+}
+
+// TLSConfig builds the *tls.Config to pass to http.Server, wiring in the
+// manager for certificate reload and the client CA pool, which is used to
+// verify client certificates only when client-auth is require+verify
+// ("request" asks for a certificate but does not verify it). ClientCAs is rebuilt per
+// handshake via GetConfigForClient (rather than baked into the returned
+// Config once) so a Reload that rotates the client CA bundle takes effect
+// on the very next handshake, the same way certificate rotation already
+// does.
+func (m *Manager) TLSConfig() (*tls.Config, error) {
+	minVersion, err := parseVersion(m.cfg.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	var cipherSuites []uint16
+	if len(m.cfg.CipherSuites) > 0 {
+		if cipherSuites, err = parseCipherSuites(m.cfg.CipherSuites); err != nil {
+			return nil, err
+		}
+	}
+
+	clientAuth, err := parseClientAuth(m.cfg.ClientAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	newConfig := func(clientCAs *x509.CertPool) *tls.Config {
+		return &tls.Config{
+			GetCertificate: m.GetCertificate,
+			NextProtos:     m.cfg.ALPNProtocols,
+			MinVersion:     minVersion,
+			CipherSuites:   cipherSuites,
+			ClientAuth:     clientAuth,
+			ClientCAs:      clientCAs,
+		}
+	}
+
+	tlsCfg := newConfig(m.getClientCAs())
+	tlsCfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		return newConfig(m.getClientCAs()), nil
+	}
+	return tlsCfg, nil
+}
+
+func parseClientAuth(a ClientAuth) (tls.ClientAuthType, error) {
+	switch a {
+	case "", ClientAuthNone:
+		return tls.NoClientCert, nil
+	case ClientAuthRequest:
+		return tls.RequestClientCert, nil
+	case ClientAuthRequireVerify:
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return 0, fmt.Errorf("tlsutil: unknown client-auth %q", a)
+	}
+}
+
+func parseVersion(v string) (uint16, error) {
+	switch v {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	default:
+		return 0, fmt.Errorf("tlsutil: unknown min-version %q", v)
+	}
+}
+
+var cipherSuitesByName = func() map[string]uint16 {
+	m := make(map[string]uint16)
+	for _, s := range tls.CipherSuites() {
+		m[s.Name] = s.ID
+	}
+	for _, s := range tls.InsecureCipherSuites() {
+		m[s.Name] = s.ID
+	}
+	return m
+}()
+
+func parseCipherSuites(names []string) ([]uint16, error) {
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := cipherSuitesByName[name]
+		if !ok {
+			return nil, fmt.Errorf("tlsutil: unknown cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// PeerIdentity returns the CN and DNS SANs of the verified client certificate
+// from an established connection, for callers (e.g. the access logger) that
+// want to record which tenant a mTLS-authenticated request came from. It
+// returns ok=false when the connection didn't present a verified client
+// certificate.
+func PeerIdentity(state *tls.ConnectionState) (cn string, sans []string, ok bool) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return "", nil, false
+	}
+	leaf := state.VerifiedChains[0][0]
+	return leaf.Subject.CommonName, leaf.DNSNames, true
+}
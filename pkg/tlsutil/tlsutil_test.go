@@ -0,0 +1,87 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVersion(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    uint16
+		wantErr bool
+	}{
+		{in: "", want: tls.VersionTLS12},
+		{in: "1.0", want: tls.VersionTLS10},
+		{in: "1.1", want: tls.VersionTLS11},
+		{in: "1.2", want: tls.VersionTLS12},
+		{in: "1.3", want: tls.VersionTLS13},
+		{in: "1.4", wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.in, func(t *testing.T) {
+			got, err := parseVersion(c.in)
+			if c.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, c.want, got)
+		})
+	}
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	ids, err := parseCipherSuites([]string{"TLS_RSA_WITH_AES_128_CBC_SHA"})
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{tls.TLS_RSA_WITH_AES_128_CBC_SHA}, ids)
+
+	_, err = parseCipherSuites([]string{"NOT_A_REAL_CIPHER"})
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "empty is valid", cfg: Config{}},
+		{name: "cert and key both set", cfg: Config{CertFile: "c", KeyFile: "k"}},
+		{name: "cert without key", cfg: Config{CertFile: "c"}, wantErr: true},
+		{name: "key without cert", cfg: Config{KeyFile: "k"}, wantErr: true},
+		{
+			name:    "client-ca-file without client-auth",
+			cfg:     Config{CertFile: "c", KeyFile: "k", ClientCAFile: "ca"},
+			wantErr: true,
+		},
+		{
+			name: "client-ca-file with client-auth",
+			cfg:  Config{CertFile: "c", KeyFile: "k", ClientCAFile: "ca", ClientAuth: ClientAuthRequireVerify},
+		},
+		{
+			name:    "require+verify without client-ca-file",
+			cfg:     Config{CertFile: "c", KeyFile: "k", ClientAuth: ClientAuthRequireVerify},
+			wantErr: true,
+		},
+		{
+			name: "request without client-ca-file is valid",
+			cfg:  Config{CertFile: "c", KeyFile: "k", ClientAuth: ClientAuthRequest},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.cfg.Validate()
+			if c.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
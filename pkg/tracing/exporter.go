@@ -0,0 +1,30 @@
+package tracing
+
+import "fmt"
+
+// newExporter builds the exporter used when tracing is enabled.
+//
+// This is an explicit placeholder, not an OTLP client: wiring a real
+// go.opentelemetry.io/otel/exporters/otlp exporter requires adding the
+// OpenTelemetry SDK as a dependency, which is tracked as a follow-up rather
+// than done here. Until then, enabling [tracing] ships spans to stdout in a
+// human-readable line, so request/span propagation, sampling and the
+// service-name tag are usable and testable without a collector running.
+// cfg.OTLPEndpoint is recorded on the exporter but never dialed.
+func newExporter(endpoint string) (Exporter, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("tracing: otlp_endpoint must be set when tracing is enabled")
+	}
+	return &stdoutExporter{endpoint: endpoint}, nil
+}
+
+// stdoutExporter prints finished spans to stdout. See newExporter's doc
+// comment: this is a stand-in for a real OTLP exporter, not one.
+type stdoutExporter struct {
+	endpoint string
+}
+
+func (e *stdoutExporter) Export(s *Span) {
+	fmt.Printf("trace=%s span=%s parent=%s name=%q duration=%s tags=%v\n",
+		s.TraceID, s.SpanID, s.ParentID, s.Name, s.End.Sub(s.Start), s.Tags)
+}
@@ -0,0 +1,262 @@
+// Package tracing provides a minimal, dependency-free span tracer used to
+// correlate a single HTTP request with the ClickHouse queries it issues.
+//
+// It is intentionally small: it speaks just enough of the W3C Trace Context
+// format to join an upstream trace (or start a new one), and hands finished
+// spans to a pluggable Exporter. When tracing is disabled in config, the
+// package-level tracer exports nothing; each request still creates a Span
+// with random trace/span IDs and stores it in the request context.
+//
+// Current scope and known gaps, tracked as follow-up work rather than
+// silently left out: the Span/Tracer types here are not OpenTelemetry types,
+// and the only Exporter implemented (see exporter.go) prints to stdout
+// instead of dialing an OTLP collector. Child-span coverage is limited to
+// helper/clickhouse.QueryWithCancel, the only query-issuing code in this
+// source tree; the find/render/index/autocomplete query paths that would
+// also need a child span per ClickHouse query aren't present here.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Span is a single unit of work within a trace. Spans form a tree rooted at
+// the request that created them; helper/clickhouse.QueryWithCancel creates a
+// child Span for each query it issues.
+type Span struct {
+	tracer   *Tracer
+	TraceID  string
+	SpanID   string
+	ParentID string
+	Name     string
+	Start    time.Time
+	End      time.Time
+	Tags     map[string]string
+	sampled  bool
+}
+
+// SetTag attaches a key/value pair to the span, e.g. the SQL text, table
+// name, row count or byte count of a ClickHouse query.
+func (s *Span) SetTag(key, value string) {
+	if s == nil {
+		return
+	}
+	if s.Tags == nil {
+		s.Tags = make(map[string]string)
+	}
+	s.Tags[key] = value
+}
+
+// Finish closes the span and hands it to the tracer's exporter.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.End = time.Now()
+	s.tracer.export(s)
+}
+
+// Exporter receives finished spans. Implementations ship them to an OTLP
+// collector, log them, or (in tests) collect them for assertions.
+type Exporter interface {
+	Export(s *Span)
+}
+
+// Tracer creates spans and forwards finished ones to an Exporter. The zero
+// value is a usable no-op tracer.
+type Tracer struct {
+	ServiceName string
+	Sampler     func(traceID string) bool
+
+	mu       sync.RWMutex
+	exporter Exporter
+}
+
+// Default is the package-level tracer used by StartSpan/StartSpanFromRequest
+// when callers don't carry their own Tracer around. It starts as a no-op
+// until Configure is called during startup.
+var Default = &Tracer{}
+
+// Config is the [tracing] config block: exporter endpoint, sampling ratio
+// and the resource attributes attached to every exported span.
+type Config struct {
+	Enabled      bool    `toml:"enabled"`
+	OTLPEndpoint string  `toml:"otlp_endpoint"`
+	SampleRatio  float64 `toml:"sample_ratio"`
+	ServiceName  string  `toml:"service_name"`
+}
+
+// Configure installs the exporter used by the Default tracer according to
+// cfg. An empty/disabled Config leaves Default without an exporter, so no
+// span is exported; spans are still created, with random IDs, per request.
+func Configure(cfg Config) error {
+	Default.mu.Lock()
+	defer Default.mu.Unlock()
+
+	if !cfg.Enabled {
+		Default.exporter = nil
+		return nil
+	}
+
+	Default.ServiceName = cfg.ServiceName
+	ratio := cfg.SampleRatio
+	Default.Sampler = func(traceID string) bool {
+		return sampleByRatio(traceID, ratio)
+	}
+
+	exp, err := newExporter(cfg.OTLPEndpoint)
+	if err != nil {
+		return err
+	}
+	Default.exporter = exp
+	return nil
+}
+
+// sampleByRatio deterministically samples a fraction of traces approximately
+// equal to ratio, keying off the last 4 hex digits of traceID (16 bits of
+// the random trace ID, treated as a uniform value in [0, 1<<16)) so the same
+// trace is always sampled the same way regardless of which span/host makes
+// the decision.
+func sampleByRatio(traceID string, ratio float64) bool {
+	if ratio >= 1 {
+		return true
+	}
+	if ratio <= 0 || len(traceID) < 4 {
+		return false
+	}
+	v, err := strconv.ParseUint(traceID[len(traceID)-4:], 16, 16)
+	if err != nil {
+		return false
+	}
+	return float64(v) < ratio*float64(1<<16)
+}
+
+func (t *Tracer) export(s *Span) {
+	if t == nil || !s.sampled {
+		return
+	}
+	t.mu.RLock()
+	exp := t.exporter
+	serviceName := t.ServiceName
+	t.mu.RUnlock()
+	if exp == nil {
+		return
+	}
+	if serviceName != "" {
+		s.SetTag("service.name", serviceName)
+	}
+	exp.Export(s)
+}
+
+// shouldSample reports whether a root span starting a new trace should be
+// sampled, using t.Sampler. A tracer with no sampler configured (the no-op
+// zero value, or before Configure has run) samples everything, since in
+// that case export is either disabled entirely or about to discard the
+// span anyway.
+func (t *Tracer) shouldSample(traceID string) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.RLock()
+	sampler := t.Sampler
+	t.mu.RUnlock()
+	if sampler == nil {
+		return true
+	}
+	return sampler(traceID)
+}
+
+type ctxKey struct{}
+
+// FromContext returns the span stored in ctx, or nil if there is none.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(ctxKey{}).(*Span)
+	return s
+}
+
+// StartSpan starts a child of the span in ctx (or a new root span if ctx has
+// none) and returns the context carrying it alongside the span itself.
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	parent := FromContext(ctx)
+
+	span := &Span{
+		tracer: Default,
+		Name:   name,
+		SpanID: newID(8),
+		Start:  time.Now(),
+	}
+
+	if parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentID = parent.SpanID
+		span.sampled = parent.sampled
+	} else {
+		span.TraceID = newID(16)
+		span.sampled = span.tracer.shouldSample(span.TraceID)
+	}
+
+	return context.WithValue(ctx, ctxKey{}, span), span
+}
+
+// StartSpanFromRequest starts a span for an incoming HTTP request, joining
+// the trace carried in the W3C traceparent header (or the B3 single header)
+// when present, and otherwise starting a new root trace.
+func StartSpanFromRequest(r *http.Request, name string) (context.Context, *Span) {
+	ctx := r.Context()
+
+	if traceID, spanID, sampled, ok := parseTraceParent(r.Header.Get("traceparent")); ok {
+		ctx = context.WithValue(ctx, ctxKey{}, &Span{TraceID: traceID, SpanID: spanID, sampled: sampled})
+	} else if traceID, spanID, sampled, ok := parseB3(r.Header.Get("b3")); ok {
+		ctx = context.WithValue(ctx, ctxKey{}, &Span{TraceID: traceID, SpanID: spanID, sampled: sampled})
+	}
+
+	return StartSpan(ctx, name)
+}
+
+func newID(bytes int) string {
+	b := make([]byte, bytes)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// parseTraceParent extracts the trace and parent span IDs, plus the sampled
+// flag (bit 0x01 of flags), from a W3C "traceparent" header of the form
+// "00-<32 hex>-<16 hex>-<flags>".
+func parseTraceParent(header string) (traceID, spanID string, sampled, ok bool) {
+	if header == "" {
+		return "", "", false, false
+	}
+	var version string
+	var flags string
+	n, err := fmt.Sscanf(header, "%2s-%32s-%16s-%2s", &version, &traceID, &spanID, &flags)
+	if err != nil || n != 4 {
+		return "", "", false, false
+	}
+	flagBits, err := strconv.ParseUint(flags, 16, 8)
+	if err != nil {
+		return "", "", false, false
+	}
+	return traceID, spanID, flagBits&0x01 != 0, true
+}
+
+// parseB3 extracts the trace and span IDs, plus the sampled flag, from a
+// single-header B3 value of the form "<traceId>-<spanId>-<sampled>-<parentSpanId>".
+// sampled is "1" or "d" (debug, which implies sampled) for a sampled trace.
+func parseB3(header string) (traceID, spanID string, sampled, ok bool) {
+	if header == "" {
+		return "", "", false, false
+	}
+	var sampledField string
+	n, err := fmt.Sscanf(header, "%32s-%16s-%1s", &traceID, &spanID, &sampledField)
+	if err != nil || n < 2 {
+		return "", "", false, false
+	}
+	return traceID, spanID, sampledField == "1" || sampledField == "d", true
+}
@@ -0,0 +1,147 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	cases := []struct {
+		name        string
+		header      string
+		wantTraceID string
+		wantSpanID  string
+		wantSampled bool
+		wantOK      bool
+	}{
+		{
+			name:        "sampled",
+			header:      "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			wantTraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+			wantSpanID:  "00f067aa0ba902b7",
+			wantSampled: true,
+			wantOK:      true,
+		},
+		{
+			name:        "not sampled",
+			header:      "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+			wantTraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+			wantSpanID:  "00f067aa0ba902b7",
+			wantSampled: false,
+			wantOK:      true,
+		},
+		{
+			name:   "empty",
+			header: "",
+			wantOK: false,
+		},
+		{
+			name:   "malformed",
+			header: "not-a-traceparent",
+			wantOK: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			traceID, spanID, sampled, ok := parseTraceParent(c.header)
+			assert.Equal(t, c.wantOK, ok)
+			if !c.wantOK {
+				return
+			}
+			assert.Equal(t, c.wantTraceID, traceID)
+			assert.Equal(t, c.wantSpanID, spanID)
+			assert.Equal(t, c.wantSampled, sampled)
+		})
+	}
+}
+
+func TestParseB3(t *testing.T) {
+	cases := []struct {
+		name        string
+		header      string
+		wantSampled bool
+		wantOK      bool
+	}{
+		{name: "sampled", header: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1", wantSampled: true, wantOK: true},
+		{name: "debug", header: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-d", wantSampled: true, wantOK: true},
+		{name: "not sampled", header: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-0", wantSampled: false, wantOK: true},
+		{name: "empty", header: "", wantOK: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			traceID, spanID, sampled, ok := parseB3(c.header)
+			assert.Equal(t, c.wantOK, ok)
+			if !c.wantOK {
+				return
+			}
+			assert.NotEmpty(t, traceID)
+			assert.NotEmpty(t, spanID)
+			assert.Equal(t, c.wantSampled, sampled)
+		})
+	}
+}
+
+type recordingExporter struct {
+	spans []*Span
+}
+
+func (e *recordingExporter) Export(s *Span) {
+	e.spans = append(e.spans, s)
+}
+
+func TestTracerExportRespectsSamplerAndServiceName(t *testing.T) {
+	exp := &recordingExporter{}
+	tracer := &Tracer{
+		ServiceName: "graphite-clickhouse",
+		Sampler:     func(traceID string) bool { return traceID == "sampled" },
+		exporter:    exp,
+	}
+
+	kept := &Span{tracer: tracer, TraceID: "sampled", SpanID: "a", sampled: tracer.shouldSample("sampled")}
+	kept.Finish()
+
+	dropped := &Span{tracer: tracer, TraceID: "dropped", SpanID: "b", sampled: tracer.shouldSample("dropped")}
+	dropped.Finish()
+
+	if assert.Len(t, exp.spans, 1) {
+		assert.Equal(t, "a", exp.spans[0].SpanID)
+		assert.Equal(t, "graphite-clickhouse", exp.spans[0].Tags["service.name"])
+	}
+}
+
+func TestSampleByRatio(t *testing.T) {
+	assert.True(t, sampleByRatio("anything", 1))
+	assert.False(t, sampleByRatio("anything", 0))
+	assert.False(t, sampleByRatio("abcd", -1))
+
+	const n = 4000
+	sampled := 0
+	rng := rand.New(rand.NewSource(1))
+	buf := make([]byte, 16)
+	for i := 0; i < n; i++ {
+		_, _ = rng.Read(buf)
+		traceID := hex.EncodeToString(buf)
+		if sampleByRatio(traceID, 0.1) {
+			sampled++
+		}
+	}
+	// With real (uniformly distributed) trace IDs, ~10% of n should be
+	// sampled; allow slack since this is a fixed, finite sample.
+	assert.InDelta(t, n/10, sampled, float64(n)*0.03)
+}
+
+func TestStartSpanFromRequestPropagatesSampledFlag(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/render/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	_, span := StartSpanFromRequest(req, "/render/")
+	assert.True(t, span.sampled)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.TraceID)
+}